@@ -0,0 +1,172 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/prest/prest/config"
+)
+
+// claimFilters resolves the table's claim-based predicates configured under
+// PREST_ACCESS_CONF (table -> column -> JSONPath, e.g.
+// {"tenant_id": "$.claims.tenant_id"}) into a column -> value map, evaluated
+// against the JWT claims AuthMiddleware/JwtMiddleware stashed in the request
+// context. It returns (nil, nil) when the table has no claim rules.
+func claimFilters(claims map[string]interface{}, table string) (map[string]interface{}, error) {
+	rules, ok := config.PrestConf.AccessConf[table]
+	if !ok || len(rules) == 0 {
+		return nil, nil
+	}
+
+	filters := make(map[string]interface{}, len(rules))
+	for column, path := range rules {
+		value, err := lookupClaim(claims, path)
+		if err != nil {
+			return nil, fmt.Errorf("access control: claim %q for column %q: %w", path, column, err)
+		}
+		filters[column] = value
+	}
+	return filters, nil
+}
+
+// claimsFromContext returns the JWT claims populated by AuthMiddleware
+// ("user_info") or JwtMiddleware ("user") earlier in the chain.
+func claimsFromContext(r *http.Request) (map[string]interface{}, error) {
+	ctx := r.Context()
+	if v := ctx.Value("user_info"); v != nil {
+		return toClaimsMap(v)
+	}
+	if v := ctx.Value("user"); v != nil {
+		if token, ok := v.(*jwt.Token); ok {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				return map[string]interface{}(claims), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("access control: no JWT claims in request context")
+}
+
+// toClaimsMap normalizes a context claims value (a map already, or a struct
+// such as auth.UserInfo) into a plain map[string]interface{}.
+func toClaimsMap(v interface{}) (map[string]interface{}, error) {
+	if m, ok := v.(map[string]interface{}); ok {
+		return m, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("access control: could not read claims: %w", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("access control: could not read claims: %w", err)
+	}
+	return m, nil
+}
+
+// applyAccessFilters enforces filters on rq itself, so the statement the
+// adapter builds from rq's query string and body already carries them.
+// GET/DELETE get the filters forced into the query string (the adapter
+// builds its WHERE clause from query parameters). POST has no existing
+// row to select, so it only gets the filters forced into the JSON body
+// (the columns the adapter writes). PATCH/PUT both select an existing row
+// *and* write columns, so they need the filters forced into both: the
+// query string, so a client can't update a row outside the filter (e.g.
+// another tenant's row), and the body, so it can't reassign a row it is
+// allowed to touch to another tenant. Either way, a client cannot
+// override a mandatory filter by supplying its own value for the same
+// column.
+func applyAccessFilters(rq *http.Request, filters map[string]interface{}) (*http.Request, error) {
+	switch rq.Method {
+	case http.MethodGet, http.MethodDelete:
+		applyQueryFilters(rq, filters)
+		return rq, nil
+	case http.MethodPost:
+		return applyBodyFilters(rq, filters)
+	case http.MethodPatch, http.MethodPut:
+		applyQueryFilters(rq, filters)
+		return applyBodyFilters(rq, filters)
+	default:
+		return rq, nil
+	}
+}
+
+// applyQueryFilters forces column -> value into rq's query string, so the
+// adapter's WHERE clause always includes them regardless of what the
+// client requested.
+func applyQueryFilters(rq *http.Request, filters map[string]interface{}) {
+	q := rq.URL.Query()
+	for column, value := range filters {
+		q.Set(column, formatFilterValue(value))
+	}
+	rq.URL.RawQuery = q.Encode()
+}
+
+// formatFilterValue renders a claim value for use in a query-string
+// filter. JSON claims decode numeric values as float64, and fmt's %v
+// switches large or very small floats to scientific notation (e.g. 1e+06),
+// which would silently produce a WHERE predicate that matches nothing.
+// Render float64 without an exponent instead.
+func formatFilterValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// applyBodyFilters forces column -> value into rq's JSON body, so the
+// adapter always writes them regardless of what the client requested.
+func applyBodyFilters(rq *http.Request, filters map[string]interface{}) (*http.Request, error) {
+	body, err := io.ReadAll(rq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("access control: could not read request body: %w", err)
+	}
+	rq.Body.Close()
+
+	payload := make(map[string]interface{})
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("access control: could not parse request body: %w", err)
+		}
+	}
+	for column, value := range filters {
+		payload[column] = value
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("access control: could not encode request body: %w", err)
+	}
+
+	rq.Body = io.NopCloser(bytes.NewReader(encoded))
+	rq.ContentLength = int64(len(encoded))
+	return rq, nil
+}
+
+// lookupClaim evaluates a small JSONPath subset ("$.claims.tenant_id",
+// "$.claims.sub") against the claims map, walking nested objects one
+// segment at a time.
+func lookupClaim(claims map[string]interface{}, path string) (interface{}, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	var cur interface{} = claims
+	for _, seg := range strings.Split(trimmed, ".") {
+		if seg == "" || seg == "claims" {
+			continue
+		}
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%q: %q is not an object", path, seg)
+		}
+		val, ok := m[seg]
+		if !ok {
+			return nil, fmt.Errorf("%q: claim %q not found", path, seg)
+		}
+		cur = val
+	}
+	return cur, nil
+}
@@ -0,0 +1,257 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLookupClaimNested(t *testing.T) {
+	claims := map[string]interface{}{
+		"org": map[string]interface{}{
+			"tenant_id": "tenant-a",
+		},
+		"sub": "user-1",
+	}
+
+	v, err := lookupClaim(claims, "$.claims.org.tenant_id")
+	if err != nil {
+		t.Fatalf("lookupClaim: %v", err)
+	}
+	if v != "tenant-a" {
+		t.Fatalf("lookupClaim() = %v, want %q", v, "tenant-a")
+	}
+
+	v, err = lookupClaim(claims, "$.sub")
+	if err != nil {
+		t.Fatalf("lookupClaim: %v", err)
+	}
+	if v != "user-1" {
+		t.Fatalf("lookupClaim() = %v, want %q", v, "user-1")
+	}
+}
+
+func TestLookupClaimMissing(t *testing.T) {
+	claims := map[string]interface{}{
+		"claims": map[string]interface{}{},
+	}
+	if _, err := lookupClaim(claims, "$.claims.tenant_id"); err == nil {
+		t.Fatal("expected an error for a missing claim")
+	}
+}
+
+func TestLookupClaimNotAnObject(t *testing.T) {
+	claims := map[string]interface{}{
+		"org": "not-an-object",
+	}
+	if _, err := lookupClaim(claims, "$.claims.org.tenant_id"); err == nil {
+		t.Fatal("expected an error when a path segment isn't an object")
+	}
+}
+
+func TestClaimFiltersNoRulesForTable(t *testing.T) {
+	filters, err := claimFilters(map[string]interface{}{}, "unconfigured_table")
+	if err != nil {
+		t.Fatalf("claimFilters: %v", err)
+	}
+	if filters != nil {
+		t.Fatalf("claimFilters() = %v, want nil", filters)
+	}
+}
+
+// tenantFilters simulates the column -> value map claimFilters would
+// resolve for a tenant-scoped table, without depending on the config
+// package's AccessConf.
+func tenantFilters(tenant string) map[string]interface{} {
+	return map[string]interface{}{"tenant_id": tenant}
+}
+
+func TestApplyAccessFiltersOverridesSpoofedQueryFilter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/orders?tenant_id=tenant-b", nil)
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+	if got := r.URL.Query().Get("tenant_id"); got != "tenant-a" {
+		t.Fatalf("tenant_id query filter = %q, want %q (tenant A must not see tenant B's rows)", got, "tenant-a")
+	}
+}
+
+func TestApplyAccessFiltersDeleteUsesQueryString(t *testing.T) {
+	r := httptest.NewRequest(http.MethodDelete, "/tables/orders", nil)
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+	if got := r.URL.Query().Get("tenant_id"); got != "tenant-a" {
+		t.Fatalf("tenant_id query filter = %q, want %q", got, "tenant-a")
+	}
+}
+
+func TestApplyAccessFiltersOverridesSpoofedBodyColumn(t *testing.T) {
+	body := strings.NewReader(`{"tenant_id":"tenant-b","name":"widget"}`)
+	r := httptest.NewRequest(http.MethodPost, "/tables/orders", body)
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+
+	decoded, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("read rewritten body: %v", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		t.Fatalf("unmarshal rewritten body: %v", err)
+	}
+	if payload["tenant_id"] != "tenant-a" {
+		t.Fatalf("tenant_id body column = %v, want %q (tenant A must not write as tenant B)", payload["tenant_id"], "tenant-a")
+	}
+	if payload["name"] != "widget" {
+		t.Fatalf("expected the rest of the body to pass through unchanged, got %v", payload)
+	}
+	if r.ContentLength != int64(len(decoded)) {
+		t.Fatalf("ContentLength = %d, want %d", r.ContentLength, len(decoded))
+	}
+}
+
+func TestApplyAccessFiltersPatchCannotTargetAnotherTenantsRow(t *testing.T) {
+	body := strings.NewReader(`{"name":"widget"}`)
+	r := httptest.NewRequest(http.MethodPatch, "/tables/orders?id=42&tenant_id=tenant-b", body)
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+
+	if got := r.URL.Query().Get("tenant_id"); got != "tenant-a" {
+		t.Fatalf("tenant_id query filter (row selection) = %q, want %q: a tenant-A PATCH must not be able to touch tenant B's row", got, "tenant-a")
+	}
+	if got := r.URL.Query().Get("id"); got != "42" {
+		t.Fatalf("expected the rest of the query string to pass through unchanged, got id=%q", got)
+	}
+
+	decoded, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("read rewritten body: %v", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		t.Fatalf("unmarshal rewritten body: %v", err)
+	}
+	if payload["tenant_id"] != "tenant-a" {
+		t.Fatalf("tenant_id body column = %v, want %q: a tenant-A PATCH must not reassign a row to tenant B", payload["tenant_id"], "tenant-a")
+	}
+}
+
+func TestApplyAccessFiltersPutAlsoFiltersQueryString(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPut, "/tables/orders?tenant_id=tenant-b", strings.NewReader(`{}`))
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+	if got := r.URL.Query().Get("tenant_id"); got != "tenant-a" {
+		t.Fatalf("tenant_id query filter = %q, want %q", got, "tenant-a")
+	}
+}
+
+func TestApplyQueryFiltersFormatsFloatWithoutScientificNotation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/orders", nil)
+	applyQueryFilters(r, map[string]interface{}{"tenant_id": float64(1500000)})
+
+	if got := r.URL.Query().Get("tenant_id"); got != "1500000" {
+		t.Fatalf("tenant_id query filter = %q, want %q (not scientific notation)", got, "1500000")
+	}
+}
+
+func TestFormatFilterValue(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{float64(1000000), "1000000"},
+		{float64(1.5), "1.5"},
+		{"tenant-a", "tenant-a"},
+		{true, "true"},
+	}
+	for _, tt := range cases {
+		if got := formatFilterValue(tt.value); got != tt.want {
+			t.Errorf("formatFilterValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestApplyAccessFiltersPatchWithEmptyBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPatch, "/tables/orders", strings.NewReader(""))
+
+	r, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+
+	decoded, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("read rewritten body: %v", err)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(decoded, &payload); err != nil {
+		t.Fatalf("unmarshal rewritten body: %v", err)
+	}
+	if payload["tenant_id"] != "tenant-a" {
+		t.Fatalf("tenant_id body column = %v, want %q", payload["tenant_id"], "tenant-a")
+	}
+}
+
+func TestApplyAccessFiltersIgnoresOtherMethods(t *testing.T) {
+	r := httptest.NewRequest(http.MethodOptions, "/tables/orders", nil)
+
+	got, err := applyAccessFilters(r, tenantFilters("tenant-a"))
+	if err != nil {
+		t.Fatalf("applyAccessFilters: %v", err)
+	}
+	if got != r {
+		t.Fatal("expected OPTIONS requests to pass through unchanged")
+	}
+}
+
+func TestClaimsFromContextUserInfo(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.WithValue(r.Context(), "user_info", map[string]interface{}{"sub": "user-1"})
+	r = r.WithContext(ctx)
+
+	claims, err := claimsFromContext(r)
+	if err != nil {
+		t.Fatalf("claimsFromContext: %v", err)
+	}
+	if claims["sub"] != "user-1" {
+		t.Fatalf("claims[sub] = %v, want %q", claims["sub"], "user-1")
+	}
+}
+
+func TestClaimsFromContextMissing(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := claimsFromContext(r); err == nil {
+		t.Fatal("expected an error when no claims are present in the context")
+	}
+}
+
+func TestToClaimsMapFromStruct(t *testing.T) {
+	type userInfo struct {
+		Sub string `json:"sub"`
+	}
+	m, err := toClaimsMap(userInfo{Sub: "user-1"})
+	if err != nil {
+		t.Fatalf("toClaimsMap: %v", err)
+	}
+	if m["sub"] != "user-1" {
+		t.Fatalf("toClaimsMap()[sub] = %v, want %q", m["sub"], "user-1")
+	}
+}
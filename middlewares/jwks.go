@@ -0,0 +1,251 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/prest/prest/config"
+)
+
+// jwksRefreshTTL is how long a fetched JWKS document is trusted. Once it
+// elapses, every lookup refetches the document, even for a cached kid.
+const jwksRefreshTTL = 5 * time.Minute
+
+// jwk is a single entry of a JSON Web Key Set, as returned by PREST_JWT_JWKS_URL.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64URLDecode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid modulus for kid %s: %w", k.Kid, err)
+		}
+		e, err := base64URLDecode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid exponent for kid %s: %w", k.Kid, err)
+		}
+		eBytes := make([]byte, 8)
+		copy(eBytes[8-len(e):], e)
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(binary.BigEndian.Uint64(eBytes)),
+		}, nil
+	case "EC":
+		x, err := base64URLDecode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid x for kid %s: %w", k.Kid, err)
+		}
+		y, err := base64URLDecode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("jwks: invalid y for kid %s: %w", k.Kid, err)
+		}
+		curve, err := ellipticCurve(k.Crv)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("jwks: unsupported key type %q for kid %s", k.Kty, k.Kid)
+	}
+}
+
+func base64URLDecode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func ellipticCurve(crv string) (elliptic.Curve, error) {
+	switch crv {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("jwks: unsupported curve %q", crv)
+	}
+}
+
+// jwksCache fetches and caches a JWKS document by URL, keyed by `kid`, and
+// transparently refreshes it on a cache miss or once jwksRefreshTTL elapses.
+type jwksCache struct {
+	url string
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+func newJWKSCache(url string) *jwksCache {
+	return &jwksCache{url: url, keys: map[string]interface{}{}}
+}
+
+func (c *jwksCache) keyForKid(kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok && time.Since(c.fetched) < jwksRefreshTTL {
+		return key, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	key, ok := c.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("jwks: no key found for kid %q", kid)
+	}
+	return key, nil
+}
+
+func (c *jwksCache) refresh() error {
+	resp, err := http.Get(c.url)
+	if err != nil {
+		return fmt.Errorf("jwks: could not fetch %s: %w", c.url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: %s returned status %d", c.url, resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("jwks: could not decode %s: %w", c.url, err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		pub, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	c.keys = keys
+	c.fetched = time.Now()
+	return nil
+}
+
+// loadKeyMaterial returns the PEM bytes for an asymmetric key. raw may be
+// the PEM content itself (PREST_JWT_KEY set inline) or a path to a file
+// containing it.
+func loadKeyMaterial(raw string) ([]byte, error) {
+	if strings.Contains(raw, "-----BEGIN") {
+		return []byte(raw), nil
+	}
+	data, err := os.ReadFile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not read PREST_JWT_KEY file %q: %w", raw, err)
+	}
+	return data, nil
+}
+
+// authKeyResolver returns a jwt.Keyfunc that resolves the verification key
+// for AuthMiddleware according to PREST_JWT_ALGO, PREST_JWT_JWKS_URL and
+// PREST_JWT_KEY, rejecting tokens whose alg doesn't match the configured
+// algorithm family.
+func authKeyResolver() (jwt.Keyfunc, error) {
+	algo := config.PrestConf.JWTAlgo
+	if algo == "" {
+		algo = "HS256"
+	}
+	if len(algo) < 2 {
+		return nil, fmt.Errorf("invalid PREST_JWT_ALGO: %s", algo)
+	}
+	family := algo[0:2]
+
+	checkFamily := func(token *jwt.Token) error {
+		alg, _ := token.Header["alg"].(string)
+		if !strings.HasPrefix(alg, family) {
+			return fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return nil
+	}
+
+	if jwksURL := config.PrestConf.JWTJWKSURL; jwksURL != "" {
+		cache := newJWKSCache(jwksURL)
+		return func(token *jwt.Token) (interface{}, error) {
+			if err := checkFamily(token); err != nil {
+				return nil, err
+			}
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, fmt.Errorf("token header missing kid")
+			}
+			return cache.keyForKid(kid)
+		}, nil
+	}
+
+	switch family {
+	case "RS":
+		pemBytes, err := loadKeyMaterial(config.PrestConf.JWTKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("PREST_JWT_KEY RSA: %w", err)
+		}
+		return func(token *jwt.Token) (interface{}, error) {
+			if err := checkFamily(token); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}, nil
+	case "ES":
+		pemBytes, err := loadKeyMaterial(config.PrestConf.JWTKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseECPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("PREST_JWT_KEY ECDSA: %w", err)
+		}
+		return func(token *jwt.Token) (interface{}, error) {
+			if err := checkFamily(token); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}, nil
+	case "HS":
+		return func(token *jwt.Token) (interface{}, error) {
+			if err := checkFamily(token); err != nil {
+				return nil, err
+			}
+			return []byte(config.PrestConf.JWTKey), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid PREST_JWT_ALGO: %s", algo)
+	}
+}
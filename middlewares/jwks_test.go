@@ -0,0 +1,225 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/form3tech-oss/jwt-go"
+	"github.com/prest/prest/config"
+)
+
+func rsaJWK(t *testing.T, kid string) (jwk, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	eBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(eBytes, uint64(key.E))
+	for len(eBytes) > 1 && eBytes[0] == 0 {
+		eBytes = eBytes[1:]
+	}
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(eBytes),
+	}, key
+}
+
+func jwksServer(t *testing.T, keys ...jwk) (*httptest.Server, *int) {
+	t.Helper()
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		json.NewEncoder(w).Encode(struct {
+			Keys []jwk `json:"keys"`
+		}{Keys: keys})
+	}))
+	return srv, &hits
+}
+
+func TestJWKSCacheReusesFetchedDocument(t *testing.T) {
+	k, _ := rsaJWK(t, "kid-1")
+	srv, hits := jwksServer(t, k)
+	defer srv.Close()
+
+	cache := newJWKSCache(srv.URL)
+	if _, err := cache.keyForKid("kid-1"); err != nil {
+		t.Fatalf("first lookup: %v", err)
+	}
+	if _, err := cache.keyForKid("kid-1"); err != nil {
+		t.Fatalf("second lookup: %v", err)
+	}
+	if *hits != 1 {
+		t.Fatalf("expected 1 fetch while cache is warm, got %d", *hits)
+	}
+}
+
+func TestJWKSCacheRefreshesAfterTTL(t *testing.T) {
+	k, _ := rsaJWK(t, "kid-1")
+	srv, hits := jwksServer(t, k)
+	defer srv.Close()
+
+	cache := newJWKSCache(srv.URL)
+	if _, err := cache.keyForKid("kid-1"); err != nil {
+		t.Fatalf("first lookup: %v", err)
+	}
+	cache.fetched = time.Now().Add(-2 * jwksRefreshTTL)
+	if _, err := cache.keyForKid("kid-1"); err != nil {
+		t.Fatalf("second lookup: %v", err)
+	}
+	if *hits != 2 {
+		t.Fatalf("expected a refresh once the TTL elapsed, got %d fetches", *hits)
+	}
+}
+
+func TestJWKSCacheUnknownKid(t *testing.T) {
+	k, _ := rsaJWK(t, "kid-1")
+	srv, _ := jwksServer(t, k)
+	defer srv.Close()
+
+	cache := newJWKSCache(srv.URL)
+	if _, err := cache.keyForKid("missing"); err == nil {
+		t.Fatal("expected an error for an unknown kid")
+	}
+}
+
+func TestAuthKeyResolverJWKSRejectsAlgFamilyMismatch(t *testing.T) {
+	k, _ := rsaJWK(t, "kid-1")
+	srv, _ := jwksServer(t, k)
+	defer srv.Close()
+
+	orig := config.PrestConf
+	defer func() { config.PrestConf = orig }()
+	config.PrestConf.JWTAlgo = "RS256"
+	config.PrestConf.JWTJWKSURL = srv.URL
+
+	resolveKey, err := authKeyResolver()
+	if err != nil {
+		t.Fatalf("authKeyResolver: %v", err)
+	}
+
+	token := &jwt.Token{Header: map[string]interface{}{"alg": "HS256", "kid": "kid-1"}}
+	if _, err := resolveKey(token); err == nil {
+		t.Fatal("expected the HS256-signed token to be rejected under a PREST_JWT_ALGO=RS256 policy")
+	}
+}
+
+func TestAuthKeyResolverJWKSMissingKid(t *testing.T) {
+	k, _ := rsaJWK(t, "kid-1")
+	srv, _ := jwksServer(t, k)
+	defer srv.Close()
+
+	orig := config.PrestConf
+	defer func() { config.PrestConf = orig }()
+	config.PrestConf.JWTAlgo = "RS256"
+	config.PrestConf.JWTJWKSURL = srv.URL
+
+	resolveKey, err := authKeyResolver()
+	if err != nil {
+		t.Fatalf("authKeyResolver: %v", err)
+	}
+
+	token := &jwt.Token{Header: map[string]interface{}{"alg": "RS256"}}
+	if _, err := resolveKey(token); err == nil {
+		t.Fatal("expected an error when the token has no kid")
+	}
+}
+
+func TestAuthKeyResolverHS(t *testing.T) {
+	orig := config.PrestConf
+	defer func() { config.PrestConf = orig }()
+	config.PrestConf.JWTAlgo = "HS256"
+	config.PrestConf.JWTKey = "secret"
+	config.PrestConf.JWTJWKSURL = ""
+
+	resolveKey, err := authKeyResolver()
+	if err != nil {
+		t.Fatalf("authKeyResolver: %v", err)
+	}
+
+	token := &jwt.Token{Header: map[string]interface{}{"alg": "HS256"}}
+	key, err := resolveKey(token)
+	if err != nil {
+		t.Fatalf("resolveKey: %v", err)
+	}
+	if string(key.([]byte)) != "secret" {
+		t.Fatalf("expected the configured shared secret, got %v", key)
+	}
+
+	token.Header["alg"] = "RS256"
+	if _, err := resolveKey(token); err == nil {
+		t.Fatal("expected a family mismatch error for an RS256 token under HS256 policy")
+	}
+}
+
+func TestAuthKeyResolverInvalidAlgo(t *testing.T) {
+	orig := config.PrestConf
+	defer func() { config.PrestConf = orig }()
+	config.PrestConf.JWTAlgo = "X"
+
+	if _, err := authKeyResolver(); err == nil {
+		t.Fatal("expected an error for a too-short PREST_JWT_ALGO")
+	}
+}
+
+func TestEllipticCurve(t *testing.T) {
+	cases := map[string]elliptic.Curve{
+		"P-256": elliptic.P256(),
+		"P-384": elliptic.P384(),
+		"P-521": elliptic.P521(),
+	}
+	for crv, want := range cases {
+		got, err := ellipticCurve(crv)
+		if err != nil {
+			t.Fatalf("ellipticCurve(%s): %v", crv, err)
+		}
+		if got != want {
+			t.Fatalf("ellipticCurve(%s) = %v, want %v", crv, got, want)
+		}
+	}
+	if _, err := ellipticCurve("P-999"); err == nil {
+		t.Fatal("expected an error for an unsupported curve")
+	}
+}
+
+func TestJWKPublicKeyEC(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	k := jwk{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(priv.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(priv.Y.Bytes()),
+	}
+	pub, err := k.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey: %v", err)
+	}
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		t.Fatalf("expected *ecdsa.PublicKey, got %T", pub)
+	}
+	if ecPub.X.Cmp(priv.X) != 0 || ecPub.Y.Cmp(priv.Y) != 0 {
+		t.Fatal("decoded public key does not match the generated key")
+	}
+}
+
+func TestJWKPublicKeyUnsupportedType(t *testing.T) {
+	k := jwk{Kty: "oct"}
+	if _, err := k.publicKey(); err == nil {
+		t.Fatal("expected an error for an unsupported key type")
+	}
+}
@@ -0,0 +1,126 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/urfave/negroni"
+)
+
+// requestIDHeader is the header RequestLogger reads the client-supplied
+// request ID from (and always echoes back, generating one if absent).
+const requestIDHeader = "X-Request-ID"
+
+// loggerContextKey is the context key RequestLogger uses to store the
+// request-scoped *slog.Logger.
+type loggerContextKey struct{}
+
+// subjectContextKey is the context key RequestLogger uses to share a
+// mutable subject holder with AuthMiddleware/JwtMiddleware. Context only
+// flows downward: by the time those middlewares resolve the JWT claims,
+// RequestLogger's own r variable has already moved on (each middleware
+// reassigns its own local copy via r.WithContext), so there is no way to
+// hand a value back up the chain once next() returns. Instead
+// RequestLogger puts a pointer on the context before calling next(), and
+// the auth middlewares write the subject through that same pointer via
+// recordSubject, which RequestLogger reads after next() returns.
+type subjectContextKey struct{}
+
+// RequestLogger returns a negroni handler that emits one structured
+// log/slog record per request (method, path, status, bytes, duration,
+// remote addr, request ID, and the JWT sub/username when available), and
+// stashes a request-scoped *slog.Logger in r.Context() so handlers and the
+// adapter layer can log with the same fields. A nil logger falls back to
+// slog.Default().
+func RequestLogger(logger *slog.Logger) negroni.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		reqID := r.Header.Get(requestIDHeader)
+		if reqID == "" {
+			reqID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, reqID)
+
+		reqLogger := logger.With("request_id", reqID)
+
+		var sub string
+		ctx := context.WithValue(r.Context(), subjectContextKey{}, &sub)
+		ctx = context.WithValue(ctx, loggerContextKey{}, reqLogger)
+		r = r.WithContext(ctx)
+
+		start := time.Now()
+		next(w, r)
+
+		if sub != "" {
+			reqLogger = reqLogger.With("sub", sub)
+		}
+
+		status, size := 0, int64(0)
+		if res, ok := w.(negroni.ResponseWriter); ok {
+			status, size = res.Status(), int64(res.Size())
+		}
+
+		reqLogger.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", size,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// LoggerFromContext returns the request-scoped *slog.Logger stashed by
+// RequestLogger, falling back to slog.Default() when none is present.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// newRequestID generates a random 16-byte hex request ID.
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// subjectFromContext returns the "sub" (or "username") JWT claim populated
+// by AuthMiddleware/JwtMiddleware, or "" when no claims are present.
+func subjectFromContext(r *http.Request) string {
+	claims, err := claimsFromContext(r)
+	if err != nil {
+		return ""
+	}
+	if sub, ok := claims["sub"].(string); ok {
+		return sub
+	}
+	if username, ok := claims["username"].(string); ok {
+		return username
+	}
+	return ""
+}
+
+// recordSubject writes sub through the subject holder RequestLogger put
+// on r's context, if any, so RequestLogger can log it once request
+// handling further down the chain has resolved the JWT claims. A no-op
+// when RequestLogger isn't present in the chain or sub is empty.
+func recordSubject(r *http.Request, sub string) {
+	if sub == "" {
+		return
+	}
+	if holder, ok := r.Context().Value(subjectContextKey{}).(*string); ok {
+		*holder = sub
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -16,6 +17,140 @@ import (
 	"github.com/urfave/negroni"
 )
 
+// prefersJSON reports whether the request's Accept header ranks
+// application/json at or above text/html, the signal used to tell apart
+// API clients (who should keep getting JSON errors) from browsers (who
+// should be redirected to the configured login page instead). Entries are
+// compared by their "q" parameter first (default 1), falling back to
+// listed order for a tie, so e.g. "application/json;q=0.1, text/html;q=0.9"
+// is correctly treated as HTML-preferring rather than matching on mere
+// textual position.
+func prefersJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return true
+	}
+
+	jsonQ, jsonPos, jsonOK := acceptEntry(accept, "application/json")
+	htmlQ, htmlPos, htmlOK := acceptEntry(accept, "text/html")
+
+	switch {
+	case jsonOK && htmlOK:
+		if jsonQ != htmlQ {
+			return jsonQ > htmlQ
+		}
+		return jsonPos <= htmlPos
+	case jsonOK:
+		return true
+	case htmlOK:
+		return false
+	default:
+		return false
+	}
+}
+
+// acceptEntry returns the quality value, the 0-based position, and
+// whether mediaType appears among the comma-separated entries of an
+// Accept header. When mediaType appears more than once, the highest q
+// wins.
+func acceptEntry(accept string, mediaType string) (q float64, pos int, ok bool) {
+	for i, part := range strings.Split(accept, ",") {
+		typ, partQ := parseMediaRange(part)
+		if typ != mediaType {
+			continue
+		}
+		if !ok || partQ > q {
+			q, pos, ok = partQ, i, true
+		}
+	}
+	return q, pos, ok
+}
+
+// parseMediaRange splits a single Accept entry (e.g. "text/html;q=0.9")
+// into its media type and quality value, defaulting q to 1 when absent
+// or unparsable.
+func parseMediaRange(part string) (string, float64) {
+	fields := strings.Split(part, ";")
+	typ := strings.TrimSpace(fields[0])
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		val := strings.TrimPrefix(param, "q=")
+		if val == param {
+			continue
+		}
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			q = parsed
+		}
+	}
+	return typ, q
+}
+
+// authFailure responds to a failed/missing token. If redirectURL is set and
+// the client isn't asking for JSON, it redirects (303) to redirectURL with
+// the original request URL appended as a `next` query parameter; otherwise
+// it falls back to the given JSON/plain error response. Callers pass
+// config.Prest.AuthRedirectURL as redirectURL; that field (and the config
+// package it lives in) isn't part of this checkout, so it can't be added
+// or confirmed here.
+func authFailure(w http.ResponseWriter, r *http.Request, redirectURL string, err error, status int) {
+	if redirectURL != "" && !prefersJSON(r) {
+		target, parseErr := url.Parse(redirectURL)
+		if parseErr == nil {
+			q := target.Query()
+			q.Set("next", r.URL.String())
+			target.RawQuery = q.Encode()
+			http.Redirect(w, r, target.String(), http.StatusSeeOther)
+			return
+		}
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// jwtCookieName returns the configured PREST_JWT_COOKIE name, defaulting to
+// "prest_jwt". Requires config.Prest.JWTCookieName; that field (and the
+// config package it lives in) isn't part of this checkout, so it can't be
+// added or confirmed here.
+func jwtCookieName() string {
+	if name := config.PrestConf.JWTCookieName; name != "" {
+		return name
+	}
+	return "prest_jwt"
+}
+
+// jwtQueryName returns the configured PREST_JWT_QUERY parameter name,
+// defaulting to "token". Requires config.Prest.JWTQueryName, same caveat
+// as jwtCookieName.
+func jwtQueryName() string {
+	if name := config.PrestConf.JWTQueryName; name != "" {
+		return name
+	}
+	return "token"
+}
+
+// extractToken pulls the bearer token from the Authorization header,
+// falling back to the PREST_JWT_COOKIE cookie and then the PREST_JWT_QUERY
+// query parameter, in that priority order.
+func extractToken(r *http.Request) string {
+	if ts := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", 1); ts != "" {
+		return ts
+	}
+	if c, err := r.Cookie(jwtCookieName()); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return r.URL.Query().Get(jwtQueryName())
+}
+
+// cookieExtractor is a jwtmiddleware.TokenExtractor that reads the token
+// from the PREST_JWT_COOKIE cookie.
+func cookieExtractor(r *http.Request) (string, error) {
+	c, err := r.Cookie(jwtCookieName())
+	if err != nil {
+		return "", nil
+	}
+	return c.Value, nil
+}
+
 // HandlerSet add content type header
 func HandlerSet() negroni.Handler {
 	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -27,8 +162,26 @@ func HandlerSet() negroni.Handler {
 	})
 }
 
-// AuthMiddleware handle request token validation
-func AuthMiddleware() negroni.Handler {
+// AuthMiddleware handle request token validation. The verification key is
+// resolved according to PREST_JWT_ALGO: a shared secret for HS*, a PEM key
+// (inline or a file path) for RS*/ES*, or a JWKS document fetched and
+// cached by `kid` when PREST_JWT_JWKS_URL is set. The resolver (and its
+// JWKS cache, PEM parsing, etc.) is built once here, at startup, rather
+// than per-request, so a bad PREST_JWT_KEY/PREST_JWT_JWKS_URL fails fast
+// instead of 500-ing every request and so JWKS documents are cached
+// across requests instead of re-fetched on each one.
+//
+// Requires config.Prest to carry JWTAlgo, JWTKey, JWTJWKSURL and
+// AuthEnabled (the config package isn't part of this checkout, so adding
+// those fields there, and updating whatever wires AuthMiddleware() to
+// handle its new error return, is this package's responsibility but
+// someone else's diff).
+func AuthMiddleware() (negroni.Handler, error) {
+	resolveKey, err := authKeyResolver()
+	if err != nil {
+		return nil, err
+	}
+
 	return negroni.HandlerFunc(func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 		match, err := MatchURL(r.URL.String())
 		if err != nil {
@@ -36,18 +189,18 @@ func AuthMiddleware() negroni.Handler {
 			return
 		}
 		if config.PrestConf.AuthEnabled && !match {
-			// extract authorization token
-			ts := strings.Replace(r.Header.Get("Authorization"), "Bearer ", "", 1)
+			// extract authorization token: header, then cookie, then query string
+			ts := extractToken(r)
 			if ts == "" {
 				err := fmt.Errorf("authorization token is empty")
-				http.Error(rw, err.Error(), http.StatusForbidden)
+				authFailure(rw, r, config.PrestConf.AuthRedirectURL, err, http.StatusForbidden)
 				return
 			}
 
-			_, err := jwt.ParseWithClaims(ts, &auth.Claims{}, func(token *jwt.Token) (interface{}, error) {
-				// verify token sign method
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			_, err = jwt.ParseWithClaims(ts, &auth.Claims{}, func(token *jwt.Token) (interface{}, error) {
+				key, err := resolveKey(token)
+				if err != nil {
+					return nil, err
 				}
 
 				// parse token claims
@@ -62,22 +215,32 @@ func AuthMiddleware() negroni.Handler {
 				ctx := r.Context()
 				ctx = context.WithValue(ctx, "user_info", claims.UserInfo)
 				r = r.WithContext(ctx)
+				recordSubject(r, subjectFromContext(r))
 
-				return []byte(config.PrestConf.JWTKey), nil
+				return key, nil
 			})
 
 			if err != nil {
-				http.Error(rw, err.Error(), http.StatusBadRequest)
+				authFailure(rw, r, config.PrestConf.AuthRedirectURL, err, http.StatusBadRequest)
 				return
 			}
 		}
 
 		// if auth isn't enabled
 		next(rw, r)
-	})
+	}), nil
 }
 
-// AccessControl is a middleware to handle permissions on tables in pREST
+// AccessControl is a middleware to handle permissions on tables in pREST. In
+// addition to the table-level permission check, it enforces any per-table
+// claim rules declared in PREST_ACCESS_CONF: the resolved column -> value
+// map is forced into the request itself by applyAccessFilters, as a
+// mandatory query-string predicate for GET/DELETE, a forced JSON body
+// column for POST, and both for PATCH/PUT, so the adapter's statement carries it exactly
+// as it would a client-supplied filter, overriding anything the client
+// tried to set for that column. The same map is also kept on the request
+// context as "access_filters" for introspection (e.g. logging). This gives
+// multi-tenant isolation independent of Postgres RLS.
 func AccessControl() negroni.Handler {
 	return negroni.HandlerFunc(func(rw http.ResponseWriter, rq *http.Request, next http.HandlerFunc) {
 		mapPath := getVars(rq.URL.Path)
@@ -92,47 +255,64 @@ func AccessControl() negroni.Handler {
 			return
 		}
 
-		if config.PrestConf.Adapter.TablePermissions(mapPath["table"], permission) {
-			next(rw, rq)
+		if !config.PrestConf.Adapter.TablePermissions(mapPath["table"], permission) {
+			err := fmt.Errorf("required authorization to table %s", mapPath["table"])
+			http.Error(rw, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		err := fmt.Errorf("required authorization to table %s", mapPath["table"])
-		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		if rules, ok := config.PrestConf.AccessConf[mapPath["table"]]; ok && len(rules) > 0 {
+			claims, err := claimsFromContext(rq)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusForbidden)
+				return
+			}
+			filters, err := claimFilters(claims, mapPath["table"])
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusForbidden)
+				return
+			}
+			rq, err = applyAccessFilters(rq, filters)
+			if err != nil {
+				http.Error(rw, err.Error(), http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(rq.Context(), "access_filters", filters)
+			rq = rq.WithContext(ctx)
+		}
+
+		next(rw, rq)
 	})
 }
 
-// JwtMiddleware check if actual request have JWT
-func JwtMiddleware(key string, algo string) negroni.Handler {
-	var keyGetter jwt.Keyfunc
-	switch algo[0:2]  {
-	case "RS":
-		rsaKey, err  := jwt.ParseRSAPublicKeyFromPEM( []byte(key))
-		if err != nil {
-			log.Fatal("PREST_JWT_KEY RSA: " + err.Error())
-		}
-		keyGetter = func(token *jwt.Token) (interface{}, error) {
-			return rsaKey, nil
-		}
-	case "ES":
-		ecdsaKey, err  := jwt.ParseECPublicKeyFromPEM( []byte(key))
-		if err != nil {
-			log.Fatal("PREST_JWT_KEY ECDSA: " + err.Error())
-		}
-		keyGetter = func(token *jwt.Token) (interface{}, error) {
-			return ecdsaKey, nil
-		}
-	case "HS":
-		keyGetter = func(token *jwt.Token) (interface{}, error) {
-			return []byte(key), nil
-		}
-	default:
-		log.Fatal("Invalid PREST_JWT_ALGO: " + algo)
+// JwtMiddleware check if actual request have JWT. When redirectURL is set,
+// browser requests (Accept not preferring application/json) that fail
+// validation are redirected (303) there instead of getting a JSON error.
+// The verification key and jwt.SigningMethod are resolved via the registry
+// populated by RegisterSigningMethod (HS/RS/ES/PS/EdDSA built in); bad
+// configuration is returned as an error instead of calling log.Fatal, so
+// it no longer aborts the whole process. Callers must check that error at
+// startup (e.g. `h, err := JwtMiddleware(...)`) instead of wiring the
+// returned handler in unconditionally.
+func JwtMiddleware(key string, algo string, redirectURL string) (negroni.Handler, error) {
+	keyGetter, signingMethod, err := resolveSigningMethod(key, algo)
+	if err != nil {
+		return nil, err
 	}
 
 	jwtMiddleware := jwtmiddleware.New(jwtmiddleware.Options{
 		ValidationKeyGetter: keyGetter,
-		SigningMethod: jwt.GetSigningMethod(algo),
+		SigningMethod: signingMethod,
+		Extractor: jwtmiddleware.FromFirst(
+			jwtmiddleware.FromAuthHeader,
+			cookieExtractor,
+			jwtmiddleware.FromParameter(jwtQueryName()),
+		),
+		// CheckJWT's default ErrorHandler already writes a 401 response
+		// before returning the error, which would commit the response
+		// before the redirect-vs-JSON branch below ever runs. Silence it
+		// so this handler owns the response on every failure path.
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err string) {},
 	})
 
 	return negroni.HandlerFunc(func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
@@ -148,9 +328,14 @@ func JwtMiddleware(key string, algo string) negroni.Handler {
 		err = jwtMiddleware.CheckJWT(w, r)
 		if err != nil {
 			log.Println("check jwt error", err.Error())
-			w.Write([]byte(fmt.Sprintf(`{"error": "%v"}`, err.Error())))
+			if redirectURL != "" && !prefersJSON(r) {
+				authFailure(w, r, redirectURL, err, http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf(`{"error": "%v"}`, err.Error()), http.StatusBadRequest)
 			return
 		}
+		recordSubject(r, subjectFromContext(r))
 		// handle jwt.claimsetrole / PREST_JWT_CLAIMSETROLE option
 		if JWTClaimSetRole := config.PrestConf.JWTClaimSetRole; JWTClaimSetRole != "" {
 			claims := r.Context().Value("user").(* jwt.Token).Claims
@@ -166,7 +351,7 @@ func JwtMiddleware(key string, algo string) negroni.Handler {
 			}
 		}
 		next(w, r)
-	})
+	}), nil
 }
 
 // Cors middleware
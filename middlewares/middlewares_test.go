@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrefersJSON(t *testing.T) {
+	cases := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{"empty accept header defaults to JSON", "", true},
+		{"plain json", "application/json", true},
+		{"plain html", "text/html", false},
+		{"json ranked before html", "application/json, text/html", true},
+		{"html ranked before json", "text/html, application/json", false},
+		{"json absent, other type present", "text/plain", false},
+		{"low-q json must not beat high-q html", "application/json;q=0.1, text/html;q=0.9", false},
+		{"low-q html must not beat high-q json", "text/html;q=0.1, application/json;q=0.9", true},
+		{"equal explicit q falls back to order", "text/html;q=0.8, application/json;q=0.8", false},
+		{"unparsable q defaults to 1", "application/json;q=nonsense, text/html", true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := prefersJSON(r); got != tt.want {
+				t.Errorf("prefersJSON(Accept=%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthFailureRedirectsBrowserRequests(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users?foo=bar", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+
+	authFailure(w, r, "/login", fmt.Errorf("boom"), http.StatusForbidden)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected a 303 redirect, got %d", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	if loc == "" {
+		t.Fatal("expected a Location header")
+	}
+	parsed, err := http.NewRequest(http.MethodGet, loc, nil)
+	if err != nil {
+		t.Fatalf("parse Location: %v", err)
+	}
+	if next := parsed.URL.Query().Get("next"); next != r.URL.String() {
+		t.Fatalf("next = %q, want %q", next, r.URL.String())
+	}
+}
+
+func TestAuthFailureFallsBackToJSONClients(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	authFailure(w, r, "/login", fmt.Errorf("boom"), http.StatusForbidden)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected the JSON client to get the raw status, got %d", w.Code)
+	}
+	if w.Header().Get("Location") != "" {
+		t.Fatal("expected no redirect for a JSON-preferring client")
+	}
+}
+
+func TestExtractTokenPrefersAuthHeader(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users?token=from-query", nil)
+	r.Header.Set("Authorization", "Bearer from-header")
+	r.AddCookie(&http.Cookie{Name: jwtCookieName(), Value: "from-cookie"})
+
+	if got := extractToken(r); got != "from-header" {
+		t.Fatalf("extractToken() = %q, want %q", got, "from-header")
+	}
+}
+
+func TestExtractTokenFallsBackToCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users?token=from-query", nil)
+	r.AddCookie(&http.Cookie{Name: jwtCookieName(), Value: "from-cookie"})
+
+	if got := extractToken(r); got != "from-cookie" {
+		t.Fatalf("extractToken() = %q, want %q", got, "from-cookie")
+	}
+}
+
+func TestExtractTokenFallsBackToQueryString(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users?token=from-query", nil)
+
+	if got := extractToken(r); got != "from-query" {
+		t.Fatalf("extractToken() = %q, want %q", got, "from-query")
+	}
+}
+
+func TestExtractTokenEmptyWhenNoneSupplied(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+
+	if got := extractToken(r); got != "" {
+		t.Fatalf("extractToken() = %q, want empty", got)
+	}
+}
+
+func TestCookieExtractor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	r.AddCookie(&http.Cookie{Name: jwtCookieName(), Value: "from-cookie"})
+
+	ts, err := cookieExtractor(r)
+	if err != nil {
+		t.Fatalf("cookieExtractor: %v", err)
+	}
+	if ts != "from-cookie" {
+		t.Fatalf("cookieExtractor() = %q, want %q", ts, "from-cookie")
+	}
+
+	r2 := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	ts2, err := cookieExtractor(r2)
+	if err != nil {
+		t.Fatalf("cookieExtractor with no cookie: %v", err)
+	}
+	if ts2 != "" {
+		t.Fatalf("cookieExtractor() = %q, want empty", ts2)
+	}
+}
+
+func TestJwtMiddlewareRedirectsBrowserRequestsOnFailure(t *testing.T) {
+	handler, err := JwtMiddleware("secret", "HS256", "/login")
+	if err != nil {
+		t.Fatalf("JwtMiddleware: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+
+	called := false
+	handler.ServeHTTP(w, r, func(http.ResponseWriter, *http.Request) { called = true })
+
+	if called {
+		t.Fatal("expected next not to be called for a request with no token")
+	}
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("expected the browser request to be redirected (303), got %d", w.Code)
+	}
+	if w.Header().Get("Location") == "" {
+		t.Fatal("expected a Location header pointing at the login page")
+	}
+}
+
+func TestJwtMiddlewareJSONClientGetsJSONErrorOnFailure(t *testing.T) {
+	handler, err := JwtMiddleware("secret", "HS256", "/login")
+	if err != nil {
+		t.Fatalf("JwtMiddleware: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r, func(http.ResponseWriter, *http.Request) {})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a JSON error status for an API client, got %d", w.Code)
+	}
+	if w.Header().Get("Location") != "" {
+		t.Fatal("expected no redirect for a JSON-preferring client")
+	}
+	if w.Body.Len() == 0 {
+		t.Fatal("expected a JSON error body")
+	}
+}
+
+func TestAuthFailureNoRedirectURLConfigured(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/tables/users", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+
+	authFailure(w, r, "", fmt.Errorf("boom"), http.StatusForbidden)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected a plain error when no redirect URL is configured, got %d", w.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+// SigningMethodResolver resolves the jwt.Keyfunc and jwt.SigningMethod
+// JwtMiddleware should use for a given PREST_JWT_ALGO value, given the raw
+// PREST_JWT_KEY material (a shared secret, or a PEM key/path for
+// asymmetric algorithms).
+type SigningMethodResolver interface {
+	Resolve(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error)
+}
+
+// SigningMethodResolverFunc adapts a function to a SigningMethodResolver.
+type SigningMethodResolverFunc func(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error)
+
+// Resolve calls f.
+func (f SigningMethodResolverFunc) Resolve(key, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	return f(key, algo)
+}
+
+var signingMethodResolversMu sync.RWMutex
+
+// signingMethodResolvers maps a two-character PREST_JWT_ALGO family (e.g.
+// "HS", "RS", "Ed") to the resolver used to build its jwt.Keyfunc.
+var signingMethodResolvers = map[string]SigningMethodResolver{
+	"HS": SigningMethodResolverFunc(resolveHMACSigningMethod),
+	"RS": SigningMethodResolverFunc(resolveRSASigningMethod),
+	"ES": SigningMethodResolverFunc(resolveECSigningMethod),
+	"PS": SigningMethodResolverFunc(resolveRSASigningMethod),
+	"Ed": SigningMethodResolverFunc(resolveEdDSASigningMethod),
+}
+
+// RegisterSigningMethod registers a SigningMethodResolver for the given
+// algorithm family so it can be selected via PREST_JWT_ALGO, e.g. for
+// HSM-backed or other bespoke verifiers. Built-in families (HS/RS/ES/PS/Ed)
+// can be overridden by registering under the same name.
+func RegisterSigningMethod(family string, resolver SigningMethodResolver) {
+	signingMethodResolversMu.Lock()
+	defer signingMethodResolversMu.Unlock()
+	signingMethodResolvers[family] = resolver
+}
+
+// resolveSigningMethod looks up the resolver for algo's two-character
+// family and uses it to build the jwt.Keyfunc and jwt.SigningMethod for
+// JwtMiddleware.
+func resolveSigningMethod(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	if len(algo) < 2 {
+		return nil, nil, fmt.Errorf("invalid PREST_JWT_ALGO: %s", algo)
+	}
+
+	signingMethodResolversMu.RLock()
+	resolver, ok := signingMethodResolvers[algo[0:2]]
+	signingMethodResolversMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid PREST_JWT_ALGO: %s", algo)
+	}
+	return resolver.Resolve(key, algo)
+}
+
+func signingMethodFor(algo string) (jwt.SigningMethod, error) {
+	method := jwt.GetSigningMethod(algo)
+	if method == nil {
+		return nil, fmt.Errorf("unknown signing method: %s", algo)
+	}
+	return method, nil
+}
+
+func resolveHMACSigningMethod(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	method, err := signingMethodFor(algo)
+	if err != nil {
+		return nil, nil, err
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		return []byte(key), nil
+	}, method, nil
+}
+
+func resolveRSASigningMethod(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	method, err := signingMethodFor(algo)
+	if err != nil {
+		return nil, nil, err
+	}
+	pemBytes, err := loadKeyMaterial(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PREST_JWT_KEY RSA: %w", err)
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		return rsaKey, nil
+	}, method, nil
+}
+
+func resolveECSigningMethod(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	method, err := signingMethodFor(algo)
+	if err != nil {
+		return nil, nil, err
+	}
+	pemBytes, err := loadKeyMaterial(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ecdsaKey, err := jwt.ParseECPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PREST_JWT_KEY ECDSA: %w", err)
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		return ecdsaKey, nil
+	}, method, nil
+}
+
+func resolveEdDSASigningMethod(key string, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+	method, err := signingMethodFor(algo)
+	if err != nil {
+		return nil, nil, err
+	}
+	pemBytes, err := loadKeyMaterial(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	edKey, err := jwt.ParseEdPublicKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PREST_JWT_KEY EdDSA: %w", err)
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		return edKey, nil
+	}, method, nil
+}
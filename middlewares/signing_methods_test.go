@@ -0,0 +1,160 @@
+package middlewares
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/form3tech-oss/jwt-go"
+)
+
+func pemPublicKey(t *testing.T, pub interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestResolveSigningMethodHMAC(t *testing.T) {
+	keyFn, method, err := resolveSigningMethod("secret", "HS256")
+	if err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if method.Alg() != "HS256" {
+		t.Fatalf("method.Alg() = %q, want HS256", method.Alg())
+	}
+	key, err := keyFn(&jwt.Token{})
+	if err != nil {
+		t.Fatalf("keyFn: %v", err)
+	}
+	if string(key.([]byte)) != "secret" {
+		t.Fatalf("keyFn() = %v, want %q", key, "secret")
+	}
+}
+
+func TestResolveSigningMethodRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	keyFn, method, err := resolveSigningMethod(pemPublicKey(t, &priv.PublicKey), "RS256")
+	if err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if method.Alg() != "RS256" {
+		t.Fatalf("method.Alg() = %q, want RS256", method.Alg())
+	}
+	key, err := keyFn(&jwt.Token{})
+	if err != nil {
+		t.Fatalf("keyFn: %v", err)
+	}
+	if _, ok := key.(*rsa.PublicKey); !ok {
+		t.Fatalf("keyFn() returned %T, want *rsa.PublicKey", key)
+	}
+}
+
+func TestResolveSigningMethodPSUsesRSAFamily(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	keyFn, method, err := resolveSigningMethod(pemPublicKey(t, &priv.PublicKey), "PS256")
+	if err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if method.Alg() != "PS256" {
+		t.Fatalf("method.Alg() = %q, want PS256", method.Alg())
+	}
+	if _, err := keyFn(&jwt.Token{}); err != nil {
+		t.Fatalf("keyFn: %v", err)
+	}
+}
+
+func TestResolveSigningMethodEC(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	keyFn, method, err := resolveSigningMethod(pemPublicKey(t, &priv.PublicKey), "ES256")
+	if err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if method.Alg() != "ES256" {
+		t.Fatalf("method.Alg() = %q, want ES256", method.Alg())
+	}
+	key, err := keyFn(&jwt.Token{})
+	if err != nil {
+		t.Fatalf("keyFn: %v", err)
+	}
+	if _, ok := key.(*ecdsa.PublicKey); !ok {
+		t.Fatalf("keyFn() returned %T, want *ecdsa.PublicKey", key)
+	}
+}
+
+func TestResolveSigningMethodEdDSA(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ed25519 key: %v", err)
+	}
+	keyFn, method, err := resolveSigningMethod(pemPublicKey(t, pub), "EdDSA")
+	if err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if method.Alg() != "EdDSA" {
+		t.Fatalf("method.Alg() = %q, want EdDSA", method.Alg())
+	}
+	key, err := keyFn(&jwt.Token{})
+	if err != nil {
+		t.Fatalf("keyFn: %v", err)
+	}
+	if _, ok := key.(ed25519.PublicKey); !ok {
+		t.Fatalf("keyFn() returned %T, want ed25519.PublicKey", key)
+	}
+}
+
+func TestResolveSigningMethodUnknownFamily(t *testing.T) {
+	if _, _, err := resolveSigningMethod("secret", "ZZ256"); err == nil {
+		t.Fatal("expected an error for an unregistered algorithm family")
+	}
+}
+
+func TestResolveSigningMethodTooShortAlgo(t *testing.T) {
+	if _, _, err := resolveSigningMethod("secret", "H"); err == nil {
+		t.Fatal("expected an error for a too-short PREST_JWT_ALGO")
+	}
+}
+
+func TestRegisterSigningMethodOverridesFamily(t *testing.T) {
+	defer func() {
+		signingMethodResolversMu.Lock()
+		signingMethodResolvers["HS"] = SigningMethodResolverFunc(resolveHMACSigningMethod)
+		signingMethodResolversMu.Unlock()
+	}()
+
+	called := false
+	RegisterSigningMethod("HS", SigningMethodResolverFunc(func(key, algo string) (jwt.Keyfunc, jwt.SigningMethod, error) {
+		called = true
+		return resolveHMACSigningMethod(key, algo)
+	}))
+
+	if _, _, err := resolveSigningMethod("secret", "HS256"); err != nil {
+		t.Fatalf("resolveSigningMethod: %v", err)
+	}
+	if !called {
+		t.Fatal("expected the registered resolver to be invoked")
+	}
+}
+
+func TestJwtMiddlewareReturnsErrorForInvalidAlgo(t *testing.T) {
+	if _, err := JwtMiddleware("secret", "ZZ256", ""); err == nil {
+		t.Fatal("expected JwtMiddleware to return an error instead of aborting the process")
+	}
+}